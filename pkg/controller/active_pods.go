@@ -0,0 +1,116 @@
+/*
+Copyright 2014 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sort"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util"
+)
+
+// activePods lets a []*api.Pod be sorted into scale-down order: the pods
+// at the front are the ones a controller should delete first when it has
+// more active pods than it wants.
+type activePods []*api.Pod
+
+func (s activePods) Len() int      { return len(s) }
+func (s activePods) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+func (s activePods) Less(i, j int) bool {
+	pi, pj := s[i], s[j]
+
+	// Pending/Unknown pods are less useful than Running ones, so they go first.
+	ranki, rankj := podPhaseRank(pi.Status.Phase), podPhaseRank(pj.Status.Phase)
+	if ranki != rankj {
+		return ranki < rankj
+	}
+
+	// Among equally-phased pods, one the scheduler hasn't placed yet is
+	// the cheapest to give up on.
+	if (pi.Spec.Host == "") != (pj.Spec.Host == "") {
+		return pi.Spec.Host == ""
+	}
+
+	// Not-ready pods go before ready ones.
+	if readyi, readyj := isPodReady(pi), isPodReady(pj); readyi != readyj {
+		return !readyi
+	}
+
+	// Newer pods go before older ones - if something's wrong with the
+	// replacement a controller just created, better to take that one
+	// back out than to disturb a pod that's been stable for a while.
+	ti, tj := podTimestamp(pi), podTimestamp(pj)
+	if !ti.Equal(tj) {
+		return ti.After(tj)
+	}
+
+	// Finally, prefer to remove the pod that's restarted the most.
+	return restartCount(pi) > restartCount(pj)
+}
+
+// podPhaseRank orders Pending before Unknown before Running (and
+// anything else, which shouldn't reach here since filterActivePods
+// already drops Succeeded/Failed pods).
+func podPhaseRank(phase api.PodPhase) int {
+	switch phase {
+	case api.PodPending:
+		return 0
+	case api.PodUnknown:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// isPodReady reports whether pod has a true PodReady condition.
+func isPodReady(pod *api.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == api.PodReady {
+			return c.Status == api.ConditionTrue
+		}
+	}
+	return false
+}
+
+// podTimestamp returns the time pod started running if known, falling
+// back to when it was created.
+func podTimestamp(pod *api.Pod) util.Time {
+	if pod.Status.StartTime != nil {
+		return *pod.Status.StartTime
+	}
+	return pod.CreationTimestamp
+}
+
+// restartCount sums the restart counts of pod's containers.
+func restartCount(pod *api.Pod) int {
+	count := 0
+	for _, cs := range pod.Status.ContainerStatuses {
+		count += cs.RestartCount
+	}
+	return count
+}
+
+// SortActivePods sorts pods into scale-down order in place: Pending and
+// Unknown pods first, then unscheduled before scheduled, then not-ready
+// before ready, then newer before
+// older, then higher restart counts before lower ones. It's exported so
+// other controllers, and callers like kubectl's "pick a victim pod"
+// logic, can reuse the same ordering instead of reimplementing it.
+func SortActivePods(pods []*api.Pod) {
+	sort.Sort(activePods(pods))
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2014 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/client/cache"
+	"github.com/golang/glog"
+)
+
+// rcExpectationsTimeout bounds how long a controller's expectations are
+// honored before they're presumed stale and discarded; this is the
+// backstop for the case where a create/delete never gets observed.
+const rcExpectationsTimeout = 5 * time.Minute
+
+// PodExpectations tracks the number of pod creates (add) and deletes
+// (del) a single sync pass of a ReplicationController has dispatched but
+// not yet seen reflected in the pod store. Both fields are decremented as
+// observations come in and may go negative if more observations arrive
+// than were expected.
+type PodExpectations struct {
+	key string
+	add int64
+	del int64
+}
+
+// Seen records that add creates and del deletes have been observed
+// against these expectations. It's exported so a caller that's already
+// holding a PodExpectations reference - e.g. a pod event handler racing
+// with the owning controller's deletion - can record an observation
+// without going back through RCExpectations, which would otherwise have
+// nothing left to look up once DeleteExpectations has run.
+func (e *PodExpectations) Seen(add, del int64) {
+	atomic.AddInt64(&e.add, -add)
+	atomic.AddInt64(&e.del, -del)
+}
+
+// expKeyFunc extracts the ReplicationController key a PodExpectations
+// entry belongs to, so RCExpectations can be backed by a cache.Store.
+func expKeyFunc(obj interface{}) (string, error) {
+	if e, ok := obj.(*PodExpectations); ok {
+		return e.key, nil
+	}
+	return "", fmt.Errorf("could not find key for obj %#v", obj)
+}
+
+// RCExpectations is a thread-safe, TTL-bound store of PodExpectations,
+// keyed by ReplicationController. A controller's sync is gated on
+// SatisfiedExpectations so a burst of creates/deletes it has already
+// dispatched doesn't get double-counted by the next sync before the
+// informer has caught up.
+type RCExpectations struct {
+	cache.Store
+}
+
+// NewRCExpectations creates an RCExpectations whose entries expire after
+// rcExpectationsTimeout if never fulfilled.
+func NewRCExpectations() *RCExpectations {
+	return &RCExpectations{cache.NewTTLStore(expKeyFunc, rcExpectationsTimeout)}
+}
+
+// GetExpectations returns the PodExpectations recorded for rc, if any.
+func (r *RCExpectations) GetExpectations(rc *api.ReplicationController) (*PodExpectations, bool, error) {
+	key, err := rcKeyFunc(rc)
+	if err != nil {
+		return nil, false, err
+	}
+	obj, exists, err := r.GetByKey(key)
+	if err != nil || !exists {
+		return nil, exists, err
+	}
+	return obj.(*PodExpectations), true, nil
+}
+
+// SatisfiedExpectations reports whether every create/delete rc's last
+// sync dispatched has since been observed (or the expectations have
+// expired). A controller with no recorded expectations is always
+// satisfied - there's nothing outstanding to wait for.
+func (r *RCExpectations) SatisfiedExpectations(rc *api.ReplicationController) bool {
+	podExp, exists, err := r.GetExpectations(rc)
+	if err != nil {
+		glog.Errorf("Error getting expectations for rc %q: %v", rc.Name, err)
+		return true
+	}
+	if !exists {
+		return true
+	}
+	if atomic.LoadInt64(&podExp.add) <= 0 && atomic.LoadInt64(&podExp.del) <= 0 {
+		return true
+	}
+	glog.V(4).Infof("Controller %v still waiting on %d creates and %d deletes", rc.Name, atomic.LoadInt64(&podExp.add), atomic.LoadInt64(&podExp.del))
+	return false
+}
+
+// setExpectations records that rc's most recent sync dispatched add
+// creates and del deletes, overwriting any prior expectations.
+func (r *RCExpectations) setExpectations(rc *api.ReplicationController, add, del int) error {
+	key, err := rcKeyFunc(rc)
+	if err != nil {
+		return err
+	}
+	return r.Add(&PodExpectations{key: key, add: int64(add), del: int64(del)})
+}
+
+// CreationObserved records that one of the creates expected for rc has
+// been seen (or, if the create failed outright, is being given back so a
+// future sync can retry it without waiting out the full TTL).
+func (r *RCExpectations) CreationObserved(rc *api.ReplicationController) {
+	if podExp, exists, err := r.GetExpectations(rc); exists && err == nil {
+		atomic.AddInt64(&podExp.add, -1)
+	}
+}
+
+// DeletionObserved records that one of the deletes expected for rc has
+// been seen.
+func (r *RCExpectations) DeletionObserved(rc *api.ReplicationController) {
+	if podExp, exists, err := r.GetExpectations(rc); exists && err == nil {
+		atomic.AddInt64(&podExp.del, -1)
+	}
+}
+
+// DeleteExpectations drops any expectations recorded for rc, so a
+// deleted controller doesn't linger until its TTL expires and so a stale
+// reference to its PodExpectations can't resurrect an entry for it.
+func (r *RCExpectations) DeleteExpectations(rc *api.ReplicationController) {
+	key, err := rcKeyFunc(rc)
+	if err != nil {
+		glog.Errorf("Couldn't get key for object %+v: %v", rc, err)
+		return
+	}
+	r.DeleteExpectationsByKey(key)
+}
+
+// DeleteExpectationsByKey is DeleteExpectations for a caller, such as
+// syncReplicationController, that only has the controller's store key
+// because the controller itself is already gone.
+func (r *RCExpectations) DeleteExpectationsByKey(key string) {
+	if podExp, exists, err := r.GetByKey(key); err == nil && exists {
+		glog.V(4).Infof("Deleting expectations for controller %v", key)
+		r.Delete(podExp)
+	}
+}
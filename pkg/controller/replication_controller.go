@@ -0,0 +1,474 @@
+/*
+Copyright 2014 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package controller contains the ReplicationManager, which keeps the
+// number of running pods selected by a ReplicationController in sync with
+// its desired replica count.
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/client"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/client/cache"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/client/record"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/fields"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/labels"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/runtime"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util/workqueue"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/watch"
+	"github.com/golang/glog"
+)
+
+const (
+	// FullControllerResyncPeriod is how often the controller store is
+	// fully relisted, as a backstop against missed watch events.
+	FullControllerResyncPeriod = 30 * time.Second
+	// PodRelistPeriod is how often the pod store is fully relisted.
+	PodRelistPeriod = 5 * time.Minute
+
+	// PodStoreSyncedPollPeriod is how long syncReplicationController waits
+	// before retrying a key it deferred because the pod store hadn't
+	// completed its initial list yet.
+	PodStoreSyncedPollPeriod = 100 * time.Millisecond
+
+	// DefaultBurstReplicas bounds the number of creates/deletes a single
+	// sync pass issues when no caller-specific value is supplied.
+	DefaultBurstReplicas = 500
+)
+
+// PodControlInterface is the interface the ReplicationManager uses to
+// create and delete pods. It exists so tests can substitute
+// FakePodControl for the real apiserver calls RealPodControl makes.
+type PodControlInterface interface {
+	createReplica(namespace string, spec *api.ReplicationController) error
+	deletePod(namespace, podName string) error
+}
+
+// RealPodControl is the production PodControlInterface: it talks to the
+// apiserver via kubeClient and records events through recorder.
+type RealPodControl struct {
+	kubeClient client.Interface
+	recorder   record.EventRecorder
+}
+
+func (r RealPodControl) createReplica(namespace string, controller *api.ReplicationController) error {
+	desiredLabels := make(labels.Set)
+	for k, v := range controller.Spec.Template.Labels {
+		desiredLabels[k] = v
+	}
+	pod := &api.Pod{
+		ObjectMeta: api.ObjectMeta{
+			Labels:       desiredLabels,
+			GenerateName: fmt.Sprintf("%s-", controller.Name),
+		},
+		Spec: controller.Spec.Template.Spec,
+	}
+	_, err := r.kubeClient.Pods(namespace).Create(pod)
+	if err != nil {
+		r.recorder.Eventf(controller, "failedCreate", "Error creating: %v", err)
+		return err
+	}
+	r.recorder.Eventf(controller, "successfulCreate", "Created pod: %v", pod.Name)
+	return nil
+}
+
+func (r RealPodControl) deletePod(namespace, podName string) error {
+	return r.kubeClient.Pods(namespace).Delete(podName, nil)
+}
+
+// rcKeyFunc returns the store key - namespace/name - for a
+// ReplicationController.
+func rcKeyFunc(rc *api.ReplicationController) (string, error) {
+	return cache.MetaNamespaceKeyFunc(rc)
+}
+
+// filterActivePods returns the subset of pods that are neither Succeeded
+// nor Failed - i.e. the ones that still count toward a controller's
+// replica count.
+func filterActivePods(pods []api.Pod) []*api.Pod {
+	var result []*api.Pod
+	for i := range pods {
+		if pods[i].Status.Phase != api.PodSucceeded && pods[i].Status.Phase != api.PodFailed {
+			result = append(result, &pods[i])
+		}
+	}
+	return result
+}
+
+// calculateStatus derives the ReplicationControllerStatus to report from
+// the currently active pods selected by rc.
+func calculateStatus(rc api.ReplicationController, filteredPods []*api.Pod) api.ReplicationControllerStatus {
+	return api.ReplicationControllerStatus{Replicas: len(filteredPods)}
+}
+
+// ReplicationManager is responsible for synchronizing ReplicationController
+// objects stored in the system with actual running pods.
+type ReplicationManager struct {
+	kubeClient client.Interface
+	podControl PodControlInterface
+
+	// burstReplicas caps the number of pod creates or deletes issued in a
+	// single sync pass, so a large diff doesn't flood the apiserver in
+	// one burst; the remainder drains over subsequent syncs.
+	burstReplicas int
+
+	// expectations tracks, per controller, the creates/deletes a sync
+	// pass has already dispatched but not yet observed, so a slow
+	// informer doesn't cause the next sync to pile on more work.
+	expectations *RCExpectations
+
+	// A store of ReplicationControllers, populated by the controllerController.
+	controllerStore cache.StoreToReplicationControllerLister
+	// Watches changes to all ReplicationControllers.
+	rcController *cache.Controller
+
+	// A store of pods, populated by the podController.
+	podStore cache.StoreToPodLister
+	// Watches changes to all pods.
+	podController *cache.Controller
+	// podStoreSynced reports whether the pod store has completed its
+	// initial list, so syncReplicationController can defer reconciling
+	// against a cache that's still empty rather than firing spurious
+	// creates for every desired replica.
+	podStoreSynced func() bool
+
+	// queue is where ReplicationController keys needing a sync are
+	// staged between being observed (via watch or relist) and processed.
+	queue *workqueue.Type
+
+	// retryManager rate-limits and bounds how many times the worker loop
+	// will put a key that failed to sync back on queue, so a persistent
+	// error (e.g. the apiserver being unreachable) backs off instead of
+	// tight-looping.
+	retryManager *RetryManager
+
+	// recorder emits events against the ReplicationControllers this
+	// manager is reconciling.
+	recorder record.EventRecorder
+
+	// syncHandler processes a single controller key; it's a field,
+	// rather than a direct call to syncReplicationController, purely so
+	// tests can substitute a fake to observe what the watch/queue
+	// plumbing delivers.
+	syncHandler func(key string) error
+}
+
+// NewReplicationManager creates a new ReplicationManager. burstReplicas
+// caps the number of pod creates or deletes a single syncReplicationController
+// pass will issue.
+func NewReplicationManager(kubeClient client.Interface, burstReplicas int) *ReplicationManager {
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartRecordingToSink(kubeClient.Events(""))
+	recorder := eventBroadcaster.NewRecorder(api.EventSource{Component: "replication-controller"})
+
+	rm := &ReplicationManager{
+		kubeClient:    kubeClient,
+		podControl:    RealPodControl{kubeClient: kubeClient, recorder: recorder},
+		burstReplicas: burstReplicas,
+		expectations:  NewRCExpectations(),
+		queue:         workqueue.New(),
+		recorder:      recorder,
+	}
+	rm.retryManager = NewRetryManager(DefaultRetryQPS, DefaultRetryBurst, DefaultMaxRetries, rm.giveUpRetrying)
+
+	rm.controllerStore.Store, rm.rcController = cache.NewInformer(
+		&cache.ListWatch{
+			ListFunc: func() (runtime.Object, error) {
+				return rm.kubeClient.ReplicationControllers(api.NamespaceAll).List(labels.Everything())
+			},
+			WatchFunc: func(rv string) (watch.Interface, error) {
+				return rm.kubeClient.ReplicationControllers(api.NamespaceAll).Watch(labels.Everything(), fields.Everything(), rv)
+			},
+		},
+		&api.ReplicationController{},
+		FullControllerResyncPeriod,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) { rm.enqueueController(obj.(*api.ReplicationController)) },
+			UpdateFunc: func(old, cur interface{}) {
+				rm.enqueueController(cur.(*api.ReplicationController))
+			},
+			DeleteFunc: func(obj interface{}) {
+				rc := obj.(*api.ReplicationController)
+				rm.expectations.DeleteExpectations(rc)
+				rm.enqueueController(rc)
+			},
+		},
+	)
+
+	rm.podStore.Store, rm.podController = cache.NewInformer(
+		&cache.ListWatch{
+			ListFunc: func() (runtime.Object, error) {
+				return rm.kubeClient.Pods(api.NamespaceAll).List(labels.Everything(), fields.Everything())
+			},
+			WatchFunc: func(rv string) (watch.Interface, error) {
+				return rm.kubeClient.Pods(api.NamespaceAll).Watch(labels.Everything(), fields.Everything(), rv)
+			},
+		},
+		&api.Pod{},
+		PodRelistPeriod,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc:    rm.addPod,
+			UpdateFunc: rm.updatePod,
+			DeleteFunc: rm.deletePod,
+		},
+	)
+
+	rm.podStoreSynced = rm.podController.HasSynced
+	rm.syncHandler = rm.syncReplicationController
+	return rm
+}
+
+// Run starts the watch loops and workers workers goroutines, blocking
+// until stopCh is closed.
+func (rm *ReplicationManager) Run(workers int, stopCh <-chan struct{}) {
+	defer util.HandleCrash()
+	go rm.rcController.Run(stopCh)
+	go rm.podController.Run(stopCh)
+	for i := 0; i < workers; i++ {
+		go util.Until(rm.worker, time.Second, stopCh)
+	}
+	<-stopCh
+	glog.Infof("Shutting down Replication Manager")
+	rm.queue.ShutDown()
+}
+
+// worker pulls controller keys off the queue and syncs them until the
+// queue is shut down.
+func (rm *ReplicationManager) worker() {
+	for {
+		func() {
+			key, quit := rm.queue.Get()
+			if quit {
+				return
+			}
+			defer rm.queue.Done(key)
+			if err := rm.syncHandler(key.(string)); err != nil {
+				glog.Errorf("Error syncing replication controller %v: %v", key, err)
+				rm.retryManager.Retry(rm.queue, key.(string))
+				return
+			}
+			rm.retryManager.Forget(key.(string))
+		}()
+	}
+}
+
+// giveUpRetrying is the retryManager's give-up hook: it's called instead
+// of a further requeue once key has exhausted its retries, and surfaces
+// why as an event on the controller, if it still exists.
+func (rm *ReplicationManager) giveUpRetrying(key string) {
+	glog.Errorf("Dropping replication controller %q out of the queue after repeated sync failures", key)
+	obj, exists, err := rm.controllerStore.Store.GetByKey(key)
+	if err != nil || !exists {
+		return
+	}
+	rm.recorder.Eventf(obj.(*api.ReplicationController), "FailedSync", "Gave up retrying after repeated sync failures")
+}
+
+func (rm *ReplicationManager) enqueueController(rc *api.ReplicationController) {
+	key, err := rcKeyFunc(rc)
+	if err != nil {
+		glog.Errorf("Couldn't get key for object %+v: %v", rc, err)
+		return
+	}
+	rm.queue.Add(key)
+}
+
+// getPodControllers returns the ReplicationController that selects pod,
+// or nil if none does.
+//
+// This walks rm.controllerStore itself rather than going through
+// cache.StoreToReplicationControllerLister.GetPodControllers, so that
+// controllerSelector is the single choke point both this and
+// syncReplicationController use to turn an rc's Selector into a
+// labels.Selector pods are matched against.
+func (rm *ReplicationManager) getPodControllers(pod *api.Pod) *api.ReplicationController {
+	if len(pod.Labels) == 0 {
+		return nil
+	}
+	var rcs []*api.ReplicationController
+	for _, m := range rm.controllerStore.Store.List() {
+		rc := m.(*api.ReplicationController)
+		if rc.Namespace != pod.Namespace {
+			continue
+		}
+		selector, err := controllerSelector(rc)
+		if err != nil {
+			glog.Errorf("Couldn't get selector for replication controller %v: %v", rc.Name, err)
+			continue
+		}
+		if selector.Matches(labels.Set(pod.Labels)) {
+			rcs = append(rcs, rc)
+		}
+	}
+	if len(rcs) == 0 {
+		return nil
+	}
+	if len(rcs) > 1 {
+		glog.Errorf("user error: more than one replication controller is selecting pods with labels: %+v", pod.Labels)
+	}
+	return rcs[0]
+}
+
+func (rm *ReplicationManager) addPod(obj interface{}) {
+	pod := obj.(*api.Pod)
+	if rc := rm.getPodControllers(pod); rc != nil {
+		rm.expectations.CreationObserved(rc)
+		rm.enqueueController(rc)
+	}
+}
+
+func (rm *ReplicationManager) updatePod(old, cur interface{}) {
+	oldPod := old.(*api.Pod)
+	curPod := cur.(*api.Pod)
+	if curRC := rm.getPodControllers(curPod); curRC != nil {
+		rm.enqueueController(curRC)
+	}
+	// A relabel can move a pod out from under one controller and under
+	// another; make sure the one it left hears about the departure too.
+	if !labels.Equals(labels.Set(oldPod.Labels), labels.Set(curPod.Labels)) {
+		if oldRC := rm.getPodControllers(oldPod); oldRC != nil {
+			rm.enqueueController(oldRC)
+		}
+	}
+}
+
+func (rm *ReplicationManager) deletePod(obj interface{}) {
+	// A delete discovered by the informer's periodic relist, rather than
+	// a live watch event, arrives wrapped in a DeletedFinalStateUnknown
+	// tombstone; unwrap it so a relist-discovered delete still clears
+	// del expectations instead of stalling a scale-down until the TTL.
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	pod, ok := obj.(*api.Pod)
+	if !ok {
+		return
+	}
+	if rc := rm.getPodControllers(pod); rc != nil {
+		rm.expectations.DeletionObserved(rc)
+		rm.enqueueController(rc)
+	}
+}
+
+// syncReplicationController is the core reconcile loop: given the key of
+// a ReplicationController, compute the diff between desired and active
+// pods and act on it, then report status.
+func (rm *ReplicationManager) syncReplicationController(key string) error {
+	if !rm.podStoreSynced() {
+		// Give the pod reflector a chance to complete its initial list
+		// before diffing against what would otherwise look like an
+		// empty pod cache, and requeue so this key is retried.
+		time.Sleep(PodStoreSyncedPollPeriod)
+		glog.Infof("Waiting for pods controller to sync, requeuing rc %v", key)
+		rm.queue.Add(key)
+		return nil
+	}
+
+	obj, exists, err := rm.controllerStore.Store.GetByKey(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		glog.Infof("ReplicationController has been deleted %v", key)
+		rm.expectations.DeleteExpectationsByKey(key)
+		return nil
+	}
+	controller := *obj.(*api.ReplicationController)
+
+	selector, err := controllerSelector(&controller)
+	if err != nil {
+		return err
+	}
+	podList, err := rm.podStore.List(selector)
+	if err != nil {
+		return err
+	}
+	var sameNamespace []api.Pod
+	for _, pod := range podList.Items {
+		if pod.Namespace == controller.Namespace {
+			sameNamespace = append(sameNamespace, pod)
+		}
+	}
+	filteredPods := filterActivePods(sameNamespace)
+
+	if rm.expectations.SatisfiedExpectations(&controller) {
+		rm.manageReplicas(filteredPods, &controller)
+	}
+
+	newStatus := calculateStatus(controller, filteredPods)
+	if controller.Status.Replicas != newStatus.Replicas {
+		controller.Status = newStatus
+		if _, err := rm.kubeClient.ReplicationControllers(controller.Namespace).Update(&controller); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// manageReplicas creates or deletes pods to close the gap between
+// rc.Spec.Replicas and the number of currently active pods, issuing at
+// most rm.burstReplicas creates or deletes in this pass. Any remaining
+// gap is left for the next sync once expectations clear.
+func (rm *ReplicationManager) manageReplicas(filteredPods []*api.Pod, rc *api.ReplicationController) {
+	diff := len(filteredPods) - rc.Spec.Replicas
+	if diff < 0 {
+		diff *= -1
+		if diff > rm.burstReplicas {
+			diff = rm.burstReplicas
+		}
+		rm.expectations.setExpectations(rc, diff, 0)
+		var wg sync.WaitGroup
+		wg.Add(diff)
+		glog.V(2).Infof("Too few %q/%q replicas, need %d, creating %d", rc.Namespace, rc.Name, rc.Spec.Replicas, diff)
+		for i := 0; i < diff; i++ {
+			go func() {
+				defer wg.Done()
+				if err := rm.podControl.createReplica(rc.Namespace, rc); err != nil {
+					rm.expectations.CreationObserved(rc)
+					util.HandleError(err)
+				}
+			}()
+		}
+		wg.Wait()
+	} else if diff > 0 {
+		if diff > rm.burstReplicas {
+			diff = rm.burstReplicas
+		}
+		rm.expectations.setExpectations(rc, 0, diff)
+		glog.V(2).Infof("Too many %q/%q replicas, need %d, deleting %d", rc.Namespace, rc.Name, rc.Spec.Replicas, diff)
+		// Prefer to delete the least useful pods first: not-yet-running
+		// ones, then not-ready ones, then the newest.
+		SortActivePods(filteredPods)
+		podsToDelete := filteredPods[:diff]
+		var wg sync.WaitGroup
+		wg.Add(diff)
+		for _, pod := range podsToDelete {
+			go func(podName string) {
+				defer wg.Done()
+				if err := rm.podControl.deletePod(rc.Namespace, podName); err != nil {
+					rm.expectations.DeletionObserved(rc)
+					util.HandleError(err)
+				}
+			}(pod.Name)
+		}
+		wg.Wait()
+	}
+}
@@ -37,9 +37,19 @@ import (
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/runtime"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/util"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/util/wait"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util/workqueue"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/watch"
 )
 
+// BurstReplicas is the burst limit used by tests that don't care about
+// exercising the burst boundary itself.
+const BurstReplicas = 100
+
+// alwaysReady is substituted for ReplicationManager.podStoreSynced by
+// tests that drive syncReplicationController directly, since they
+// populate the pod store themselves rather than running the informer.
+var alwaysReady = func() bool { return true }
+
 type FakePodControl struct {
 	controllerSpec []api.ReplicationController
 	deletePodName  []string
@@ -217,7 +227,8 @@ func startManagerAndWait(manager *ReplicationManager, pods int, t *testing.T) ch
 func TestSyncReplicationControllerDoesNothing(t *testing.T) {
 	client := client.NewOrDie(&client.Config{Host: "", Version: testapi.Version()})
 	fakePodControl := FakePodControl{}
-	manager := NewReplicationManager(client)
+	manager := NewReplicationManager(client, BurstReplicas)
+	manager.podStoreSynced = alwaysReady
 
 	// 2 running pods, a controller with 2 replicas, sync is a no-op
 	controllerSpec := newReplicationController(2)
@@ -232,7 +243,8 @@ func TestSyncReplicationControllerDoesNothing(t *testing.T) {
 func TestSyncReplicationControllerDeletes(t *testing.T) {
 	client := client.NewOrDie(&client.Config{Host: "", Version: testapi.Version()})
 	fakePodControl := FakePodControl{}
-	manager := NewReplicationManager(client)
+	manager := NewReplicationManager(client, BurstReplicas)
+	manager.podStoreSynced = alwaysReady
 	manager.podControl = &fakePodControl
 
 	// 2 running pods and a controller with 1 replica, one pod delete expected
@@ -244,9 +256,46 @@ func TestSyncReplicationControllerDeletes(t *testing.T) {
 	validateSyncReplication(t, &fakePodControl, 0, 1)
 }
 
+func TestSyncReplicationControllerDeletesPendingPodsFirst(t *testing.T) {
+	client := client.NewOrDie(&client.Config{Host: "", Version: testapi.Version()})
+	fakePodControl := FakePodControl{}
+	manager := NewReplicationManager(client, BurstReplicas)
+	manager.podStoreSynced = alwaysReady
+	manager.podControl = &fakePodControl
+
+	// A controller with 1 replica, but 2 active pods match its selector:
+	// one still Pending, one Running. The scale-down should pick the
+	// Pending pod, not whichever the store happens to return first.
+	controllerSpec := newReplicationController(1)
+	manager.controllerStore.Store.Add(controllerSpec)
+	manager.podStore.Store.Add(&api.Pod{
+		ObjectMeta: api.ObjectMeta{
+			Name:      "running-pod",
+			Labels:    controllerSpec.Spec.Selector,
+			Namespace: controllerSpec.Namespace,
+		},
+		Status: api.PodStatus{Phase: api.PodRunning},
+	})
+	manager.podStore.Store.Add(&api.Pod{
+		ObjectMeta: api.ObjectMeta{
+			Name:      "pending-pod",
+			Labels:    controllerSpec.Spec.Selector,
+			Namespace: controllerSpec.Namespace,
+		},
+		Status: api.PodStatus{Phase: api.PodPending},
+	})
+
+	manager.syncReplicationController(getKey(controllerSpec, t))
+	validateSyncReplication(t, &fakePodControl, 0, 1)
+	if len(fakePodControl.deletePodName) == 1 && fakePodControl.deletePodName[0] != "pending-pod" {
+		t.Errorf("Expected the Pending pod to be deleted first, got %v", fakePodControl.deletePodName)
+	}
+}
+
 func TestSyncReplicationControllerCreates(t *testing.T) {
 	client := client.NewOrDie(&client.Config{Host: "", Version: testapi.Version()})
-	manager := NewReplicationManager(client)
+	manager := NewReplicationManager(client, BurstReplicas)
+	manager.podStoreSynced = alwaysReady
 
 	// A controller with 2 replicas and no pods in the store, 2 creates expected
 	controller := newReplicationController(2)
@@ -258,6 +307,57 @@ func TestSyncReplicationControllerCreates(t *testing.T) {
 	validateSyncReplication(t, &fakePodControl, 2, 0)
 }
 
+func TestSyncReplicationControllerDoesNothingWhenPodStoreNotSynced(t *testing.T) {
+	client := client.NewOrDie(&client.Config{Host: "", Version: testapi.Version()})
+	fakePodControl := FakePodControl{}
+	manager := NewReplicationManager(client, BurstReplicas)
+	manager.podStoreSynced = func() bool { return false }
+	manager.podControl = &fakePodControl
+
+	// A controller with 2 replicas and no pods in the store would
+	// normally trigger 2 creates, but the pod store hasn't finished its
+	// initial list yet, so the sync should be deferred entirely.
+	controllerSpec := newReplicationController(2)
+	manager.controllerStore.Store.Add(controllerSpec)
+
+	manager.syncReplicationController(getKey(controllerSpec, t))
+	validateSyncReplication(t, &fakePodControl, 0, 0)
+}
+
+func TestSyncReplicationControllerCreatesRespectsBurst(t *testing.T) {
+	client := client.NewOrDie(&client.Config{Host: "", Version: testapi.Version()})
+	manager := NewReplicationManager(client, 3)
+	manager.podStoreSynced = alwaysReady
+	fakePodControl := FakePodControl{}
+	manager.podControl = &fakePodControl
+
+	// A controller with 10 more replicas than pods in the store; with a
+	// burst of 3, each sync should only ever dispatch 3 creates, and it
+	// should take 4 syncs (3+3+3+1) to converge.
+	controller := newReplicationController(10)
+	manager.controllerStore.Store.Add(controller)
+
+	expectedCreates := []int{3, 3, 3, 1}
+	existing := 0
+	for _, expected := range expectedCreates {
+		fakePodControl.clear()
+		manager.syncReplicationController(getKey(controller, t))
+		validateSyncReplication(t, &fakePodControl, expected, 0)
+		for i := 0; i < expected; i++ {
+			manager.expectations.CreationObserved(controller)
+			manager.podStore.Store.Add(&api.Pod{
+				ObjectMeta: api.ObjectMeta{
+					Name:      fmt.Sprintf("pod%d", existing+i),
+					Labels:    controller.Spec.Selector,
+					Namespace: controller.Namespace,
+				},
+				Status: api.PodStatus{Phase: api.PodRunning},
+			})
+		}
+		existing += expected
+	}
+}
+
 func TestCreateReplica(t *testing.T) {
 	ns := api.NamespaceDefault
 	body := runtime.EncodeOrDie(testapi.Codec(), &api.Pod{ObjectMeta: api.ObjectMeta{Name: "empty_pod"}})
@@ -311,7 +411,8 @@ func TestControllerNoReplicaUpdate(t *testing.T) {
 	testServer := httptest.NewServer(&fakeHandler)
 	defer testServer.Close()
 	client := client.NewOrDie(&client.Config{Host: testServer.URL, Version: testapi.Version()})
-	manager := NewReplicationManager(client)
+	manager := NewReplicationManager(client, BurstReplicas)
+	manager.podStoreSynced = alwaysReady
 
 	// Steady state for the replication controller, no Status.Replicas updates expected
 	activePods := 5
@@ -340,7 +441,8 @@ func TestControllerUpdateReplicas(t *testing.T) {
 	defer testServer.Close()
 
 	client := client.NewOrDie(&client.Config{Host: testServer.URL, Version: testapi.Version()})
-	manager := NewReplicationManager(client)
+	manager := NewReplicationManager(client, BurstReplicas)
+	manager.podStoreSynced = alwaysReady
 
 	// Insufficient number of pods in the system, and Status.Replicas is wrong;
 	// Status.Replica should update to match number of pods in system, 1 new pod should be created.
@@ -512,6 +614,90 @@ func TestRCExpectations(t *testing.T) {
 	}
 }
 
+// TestSyncReplicationControllerNoDoubleCreateOnSlowInformer simulates a
+// burst create racing the informer: a second sync fired before the
+// reflector has delivered the add events for pods the first sync just
+// created must not issue more creates, and addPod must clear the
+// expectations those add events represent so the sync after that can
+// proceed normally.
+func TestSyncReplicationControllerNoDoubleCreateOnSlowInformer(t *testing.T) {
+	client := client.NewOrDie(&client.Config{Host: "", Version: testapi.Version()})
+	manager := NewReplicationManager(client, BurstReplicas)
+	manager.podStoreSynced = alwaysReady
+	fakePodControl := FakePodControl{}
+	manager.podControl = &fakePodControl
+
+	controller := newReplicationController(2)
+	manager.controllerStore.Store.Add(controller)
+
+	manager.syncReplicationController(getKey(controller, t))
+	validateSyncReplication(t, &fakePodControl, 2, 0)
+
+	// The informer hasn't delivered the adds yet, so a sync here must be
+	// a no-op rather than creating 2 more pods.
+	fakePodControl.clear()
+	manager.syncReplicationController(getKey(controller, t))
+	validateSyncReplication(t, &fakePodControl, 0, 0)
+
+	// The adds finally show up via the pod watch.
+	for i := 0; i < 2; i++ {
+		pod := &api.Pod{
+			ObjectMeta: api.ObjectMeta{
+				Name:      fmt.Sprintf("pod%d", i),
+				Labels:    controller.Spec.Selector,
+				Namespace: controller.Namespace,
+			},
+			Status: api.PodStatus{Phase: api.PodRunning},
+		}
+		manager.podStore.Store.Add(pod)
+		manager.addPod(pod)
+	}
+	if !manager.expectations.SatisfiedExpectations(controller) {
+		t.Errorf("Expectations should be satisfied after both adds are observed")
+	}
+
+	// Now that expectations are satisfied and the store reflects 2 pods, nothing left to do.
+	fakePodControl.clear()
+	manager.syncReplicationController(getKey(controller, t))
+	validateSyncReplication(t, &fakePodControl, 0, 0)
+}
+
+func TestRCExpectationsDeletedOnControllerDelete(t *testing.T) {
+	client := client.NewOrDie(&client.Config{Host: "", Version: testapi.Version()})
+	manager := NewReplicationManager(client, BurstReplicas)
+	manager.podStoreSynced = alwaysReady
+	fakePodControl := FakePodControl{}
+	manager.podControl = &fakePodControl
+
+	rc := newReplicationController(1)
+	manager.controllerStore.Store.Add(rc)
+	manager.expectations.setExpectations(rc, 1, 0)
+
+	// Simulate a pod-add handler that looked up the expectations before
+	// the controller was deleted, and only gets around to recording the
+	// observation afterward.
+	staleExp, exists, err := manager.expectations.GetExpectations(rc)
+	if err != nil || !exists {
+		t.Fatalf("Could not get expectations for rc, exists %v and err %v", exists, err)
+	}
+
+	manager.controllerStore.Store.Delete(rc)
+	manager.expectations.DeleteExpectationsByKey(getKey(rc, t))
+
+	// A late observation against the stale reference must not resurrect
+	// the deleted controller's expectations.
+	staleExp.Seen(1, 0)
+	if _, exists, _ := manager.expectations.GetExpectations(rc); exists {
+		t.Errorf("Expectations for a deleted rc should not exist, but they do")
+	}
+
+	manager.syncReplicationController(getKey(rc, t))
+	validateSyncReplication(t, &fakePodControl, 0, 0)
+	if _, exists, _ := manager.expectations.GetExpectations(rc); exists {
+		t.Errorf("Expectations for a deleted rc should not exist, but they do")
+	}
+}
+
 func TestSyncReplicationControllerDormancy(t *testing.T) {
 	// Setup a test server so we can lie about the current state of pods
 	fakeHandler := util.FakeHandler{
@@ -523,7 +709,8 @@ func TestSyncReplicationControllerDormancy(t *testing.T) {
 	client := client.NewOrDie(&client.Config{Host: testServer.URL, Version: testapi.Version()})
 
 	fakePodControl := FakePodControl{}
-	manager := NewReplicationManager(client)
+	manager := NewReplicationManager(client, BurstReplicas)
+	manager.podStoreSynced = alwaysReady
 	manager.podControl = &fakePodControl
 
 	controllerSpec := newReplicationController(2)
@@ -562,7 +749,8 @@ func TestSyncReplicationControllerDormancy(t *testing.T) {
 }
 
 func TestPodControllerLookup(t *testing.T) {
-	manager := NewReplicationManager(client.NewOrDie(&client.Config{Host: "", Version: testapi.Version()}))
+	manager := NewReplicationManager(client.NewOrDie(&client.Config{Host: "", Version: testapi.Version()}), BurstReplicas)
+	manager.podStoreSynced = alwaysReady
 	testCases := []struct {
 		inRCs     []*api.ReplicationController
 		pod       *api.Pod
@@ -620,15 +808,112 @@ func TestPodControllerLookup(t *testing.T) {
 	}
 }
 
+// TestPodControllerLookupNamespaceScoped verifies getPodControllers filters
+// candidates by namespace before consulting controllerSelector, so that two
+// rcs with the same Selector in different namespaces don't cross-match.
+func TestPodControllerLookupNamespaceScoped(t *testing.T) {
+	manager := NewReplicationManager(client.NewOrDie(&client.Config{Host: "", Version: testapi.Version()}), BurstReplicas)
+	manager.podStoreSynced = alwaysReady
+
+	nsFoo := &api.ReplicationController{
+		ObjectMeta: api.ObjectMeta{Name: "foo", Namespace: "ns-foo"},
+		Spec:       api.ReplicationControllerSpec{Selector: map[string]string{"foo": "bar"}},
+	}
+	nsBar := &api.ReplicationController{
+		ObjectMeta: api.ObjectMeta{Name: "bar", Namespace: "ns-bar"},
+		Spec:       api.ReplicationControllerSpec{Selector: map[string]string{"foo": "bar"}},
+	}
+	manager.controllerStore.Add(nsFoo)
+	manager.controllerStore.Add(nsBar)
+
+	pod := &api.Pod{
+		ObjectMeta: api.ObjectMeta{
+			Name: "pod", Namespace: "ns-bar", Labels: map[string]string{"foo": "bar"}},
+	}
+	rc := manager.getPodControllers(pod)
+	if rc == nil || rc.Name != nsBar.Name {
+		t.Errorf("Expected pod to match controller %q, got %+v", nsBar.Name, rc)
+	}
+}
+
+// TestDeletePodUnwrapsTombstone verifies deletePod unwraps a
+// cache.DeletedFinalStateUnknown tombstone - the form a relist-discovered
+// delete arrives in, as opposed to a live watch delete - so del
+// expectations are still observed instead of stalling until the TTL.
+func TestDeletePodUnwrapsTombstone(t *testing.T) {
+	manager := NewReplicationManager(client.NewOrDie(&client.Config{Host: "", Version: testapi.Version()}), BurstReplicas)
+	manager.podStoreSynced = alwaysReady
+
+	rc := newReplicationController(1)
+	manager.controllerStore.Store.Add(rc)
+	manager.expectations.setExpectations(rc, 0, 1)
+
+	pod := newPodList(nil, 1, api.PodRunning, rc).Items[0]
+	manager.deletePod(cache.DeletedFinalStateUnknown{Key: "default/pod", Obj: &pod})
+
+	if !manager.expectations.SatisfiedExpectations(rc) {
+		t.Errorf("Expected the tombstoned delete to satisfy expectations")
+	}
+}
+
 type FakeWatcher struct {
 	w *watch.FakeWatcher
 	*testclient.Fake
 }
 
+func TestRetryManagerGivesUpAfterMaxRetries(t *testing.T) {
+	const maxRetries = 3
+	var gaveUp []string
+	rm := NewRetryManager(1000, 1000, maxRetries, func(key string) {
+		gaveUp = append(gaveUp, key)
+	})
+	queue := workqueue.New()
+	defer queue.ShutDown()
+
+	key := "default/foo"
+	for i := 0; i < maxRetries; i++ {
+		rm.Retry(queue, key)
+		if count := rm.RetryCount(key); count != i+1 {
+			t.Errorf("Expected retry count %d, got %d", i+1, count)
+		}
+	}
+	if len(gaveUp) != 0 {
+		t.Errorf("Expected no give-up yet, got %v", gaveUp)
+	}
+
+	// One more failure exhausts the retry budget.
+	rm.Retry(queue, key)
+	if count := rm.RetryCount(key); count != 0 {
+		t.Errorf("Expected retry count to be reset after giving up, got %d", count)
+	}
+	if !reflect.DeepEqual(gaveUp, []string{key}) {
+		t.Errorf("Expected give-up callback for %v, got %v", key, gaveUp)
+	}
+}
+
+func TestRetryManagerForgetResetsCount(t *testing.T) {
+	rm := NewRetryManager(1000, 1000, 5, nil)
+	queue := workqueue.New()
+	defer queue.ShutDown()
+
+	key := "default/foo"
+	rm.Retry(queue, key)
+	rm.Retry(queue, key)
+	if count := rm.RetryCount(key); count != 2 {
+		t.Errorf("Expected retry count 2, got %d", count)
+	}
+
+	rm.Forget(key)
+	if count := rm.RetryCount(key); count != 0 {
+		t.Errorf("Expected retry count to be reset after Forget, got %d", count)
+	}
+}
+
 func TestWatchControllers(t *testing.T) {
 	fakeWatch := watch.NewFake()
 	client := &testclient.Fake{Watch: fakeWatch}
-	manager := NewReplicationManager(client)
+	manager := NewReplicationManager(client, BurstReplicas)
+	manager.podStoreSynced = alwaysReady
 
 	var testControllerSpec api.ReplicationController
 	received := make(chan string)
@@ -669,7 +954,8 @@ func TestWatchControllers(t *testing.T) {
 func TestWatchPods(t *testing.T) {
 	fakeWatch := watch.NewFake()
 	client := &testclient.Fake{Watch: fakeWatch}
-	manager := NewReplicationManager(client)
+	manager := NewReplicationManager(client, BurstReplicas)
+	manager.podStoreSynced = alwaysReady
 
 	// Put one rc and one pod into the controller's stores
 	testControllerSpec := newReplicationController(1)
@@ -712,7 +998,8 @@ func TestWatchPods(t *testing.T) {
 func TestUpdatePods(t *testing.T) {
 	fakeWatch := watch.NewFake()
 	client := &testclient.Fake{Watch: fakeWatch}
-	manager := NewReplicationManager(client)
+	manager := NewReplicationManager(client, BurstReplicas)
+	manager.podStoreSynced = alwaysReady
 
 	received := make(chan string)
 
@@ -0,0 +1,104 @@
+/*
+Copyright 2014 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sync"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util/workqueue"
+)
+
+const (
+	// DefaultRetryQPS is the steady-state rate at which failed keys are
+	// allowed back onto a queue guarded by a RetryManager.
+	DefaultRetryQPS = 1.0
+	// DefaultRetryBurst is how many retries a RetryManager allows in a
+	// burst before DefaultRetryQPS throttling kicks in.
+	DefaultRetryBurst = 10
+	// DefaultMaxRetries is how many times a key may be retried before a
+	// RetryManager gives up on it.
+	DefaultMaxRetries = 5
+)
+
+// RetryManager rate-limits and bounds how many times a key is put back
+// on a workqueue after a failed sync, so a persistent error (e.g. the
+// apiserver being unreachable) backs off instead of tight-looping the
+// worker that drains the queue.
+type RetryManager struct {
+	rateLimiter util.RateLimiter
+	maxRetries  int
+	// onGiveUp, if set, is called in place of a requeue once a key has
+	// been retried maxRetries times.
+	onGiveUp func(key string)
+
+	lock        sync.Mutex
+	retryCounts map[string]int
+}
+
+// NewRetryManager creates a RetryManager backed by a token-bucket rate
+// limiter accepting qps retries per second, up to burst at once, and
+// giving up on a key after maxRetries failures.
+func NewRetryManager(qps float32, burst, maxRetries int, onGiveUp func(key string)) *RetryManager {
+	return &RetryManager{
+		rateLimiter: util.NewTokenBucketRateLimiter(qps, burst),
+		maxRetries:  maxRetries,
+		onGiveUp:    onGiveUp,
+		retryCounts: map[string]int{},
+	}
+}
+
+// Retry decides whether key, which just failed to sync, should go back
+// onto queue. A key that has already failed maxRetries times is dropped
+// instead: its retry count is forgotten and onGiveUp, if set, is invoked.
+// Otherwise Retry blocks on the rate limiter, bumps key's retry count,
+// and re-adds it to queue.
+func (r *RetryManager) Retry(queue *workqueue.Type, key string) {
+	r.lock.Lock()
+	count := r.retryCounts[key]
+	r.lock.Unlock()
+
+	if count >= r.maxRetries {
+		r.Forget(key)
+		if r.onGiveUp != nil {
+			r.onGiveUp(key)
+		}
+		return
+	}
+
+	r.rateLimiter.Accept()
+
+	r.lock.Lock()
+	r.retryCounts[key] = count + 1
+	r.lock.Unlock()
+	queue.Add(key)
+}
+
+// Forget resets key's retry count. Call it once key has synced
+// successfully so a later, unrelated failure starts counting from zero.
+func (r *RetryManager) Forget(key string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.retryCounts, key)
+}
+
+// RetryCount returns how many times key has been retried so far.
+func (r *RetryManager) RetryCount(key string) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.retryCounts[key]
+}
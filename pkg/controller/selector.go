@@ -0,0 +1,48 @@
+/*
+Copyright 2014 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/labels"
+)
+
+// controllerSelector returns the labels.Selector that matches the pods
+// rc owns. It is the single choke point syncReplicationController and
+// the pod event handlers go through to get rc's selector.
+//
+// TODO(chunk2-3): this is equality-only and does NOT implement set-based
+// matching (matchLabels/matchExpressions, i.e. In/NotIn/Exists/
+// DoesNotExist). That is deferred, not done - it is blocked on two
+// packages this tree doesn't contain a copy of, so there is nothing here
+// to build it on top of:
+//   - api.ReplicationControllerSpec.Selector would need to become a
+//     structured type carrying matchExpressions, rather than the plain
+//     map[string]string it is today (pkg/api).
+//   - labels.Selector/Requirement construction from that structured
+//     type would need a parser for the In/NotIn/Exists/DoesNotExist
+//     operators (pkg/labels).
+//
+// See TestControllerSelectorSetBasedMatching in selector_test.go, which
+// is skipped with this same TODO rather than omitted, so the gap shows
+// up in `go test` output instead of only in a comment. Until both
+// packages exist, this function is equivalent to
+// labels.Set(rc.Spec.Selector).AsSelector() and callers should not rely
+// on it for anything beyond that.
+func controllerSelector(rc *api.ReplicationController) (labels.Selector, error) {
+	return labels.Set(rc.Spec.Selector).AsSelector(), nil
+}
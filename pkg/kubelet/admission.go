@@ -0,0 +1,116 @@
+/*
+Copyright 2014 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubelet
+
+import (
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	kubecontainer "github.com/GoogleCloudPlatform/kubernetes/pkg/kubelet/container"
+)
+
+// AdmissionHandler decides whether a pod may run on this node. podWorkers
+// consults every registered AdmissionHandler before calling syncPodFn for
+// any sync other than a kill, so
+// predicates like node resource pressure, PodFitsResources against
+// allocatable, or a node-selector/affinity recheck after a kubelet
+// restart can all gate the sync from one place, rather than being
+// scattered across the sync path as they are today.
+type AdmissionHandler interface {
+	// Admit returns whether pod may be synced. runningPods is the
+	// runtime's current view of pods on the node, for predicates that
+	// need to reason about what's already running.
+	Admit(pod *api.Pod, mirrorPod *api.Pod, runningPods []*kubecontainer.Pod) (admit bool, reason, message string)
+}
+
+// EvictionHandler decides whether an already-admitted pod should instead
+// be evicted, e.g. because the node is now under resource pressure or
+// out of disk. It's consulted after AdmissionHandlers, on every sync, not
+// just the first.
+type EvictionHandler interface {
+	ShouldEvict(pod *api.Pod, runningPods []*kubecontainer.Pod) (evict bool, reason, message string)
+}
+
+// PodStatusSetter is the status manager callback podWorkers uses to
+// record why a pod was rejected at the admission gate, without podWorkers
+// needing to know how pod status is persisted.
+type PodStatusSetter interface {
+	SetPodStatus(pod *api.Pod, status api.PodStatus)
+}
+
+// AddAdmissionHandler registers h to be consulted before every sync other
+// than a kill. Handlers run in registration order and the first rejection
+// wins.
+func (p *podWorkers) AddAdmissionHandler(h AdmissionHandler) {
+	p.podLock.Lock()
+	defer p.podLock.Unlock()
+	p.admissionHandlers = append(p.admissionHandlers, h)
+}
+
+// AddEvictionHandler registers h to be consulted before every sync other
+// than a kill, after admission handlers have all passed.
+func (p *podWorkers) AddEvictionHandler(h EvictionHandler) {
+	p.podLock.Lock()
+	defer p.podLock.Unlock()
+	p.evictionHandlers = append(p.evictionHandlers, h)
+}
+
+// SetPodStatusSetter injects the status manager callback used to record a
+// FailedAdmission status on rejection.
+func (p *podWorkers) SetPodStatusSetter(s PodStatusSetter) {
+	p.podLock.Lock()
+	defer p.podLock.Unlock()
+	p.statusSetter = s
+}
+
+// admitPod runs every registered AdmissionHandler and then EvictionHandler
+// for work.pod, returning the first rejection encountered, if any.
+func (p *podWorkers) admitPod(work workUpdate, runningPods []*kubecontainer.Pod) (admit bool, reason, message string) {
+	p.podLock.Lock()
+	admissionHandlers := p.admissionHandlers
+	evictionHandlers := p.evictionHandlers
+	p.podLock.Unlock()
+
+	for _, h := range admissionHandlers {
+		if ok, reason, message := h.Admit(work.pod, work.mirrorPod, runningPods); !ok {
+			return false, reason, message
+		}
+	}
+	for _, h := range evictionHandlers {
+		if evict, reason, message := h.ShouldEvict(work.pod, runningPods); evict {
+			return false, reason, message
+		}
+	}
+	return true, "", ""
+}
+
+// rejectPod records why work.pod was kept from syncing: it emits a
+// FailedAdmission event and, if a status setter is injected, updates the
+// pod's status to reflect the rejection.
+func (p *podWorkers) rejectPod(work workUpdate, reason, message string) {
+	p.recorder.Eventf(work.pod, "FailedAdmission", "Pod was rejected: %s: %s", reason, message)
+
+	p.podLock.Lock()
+	statusSetter := p.statusSetter
+	p.podLock.Unlock()
+	if statusSetter == nil {
+		return
+	}
+	status := work.pod.Status
+	status.Phase = api.PodFailed
+	status.Reason = reason
+	status.Message = message
+	statusSetter.SetPodStatus(work.pod, status)
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2014 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics registers the Prometheus metrics exposed by the
+// kubelet's pod workers.
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const kubeletSubsystem = "kubelet"
+
+var (
+	// PodWorkerQueueDepth tracks how many pod sync requests are currently
+	// waiting to be picked up by the bounded worker pool.
+	PodWorkerQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Subsystem: kubeletSubsystem,
+		Name:      "pod_worker_queue_depth",
+		Help:      "Number of pod sync requests queued but not yet dispatched to a worker.",
+	})
+	// PodWorkersInFlight tracks how many of the bounded pod workers are
+	// currently executing syncPodFn.
+	PodWorkersInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Subsystem: kubeletSubsystem,
+		Name:      "pod_workers_in_flight",
+		Help:      "Number of pod workers currently syncing a pod.",
+	})
+	// PodWorkerSyncDuration is a histogram of how long syncPodFn takes,
+	// broken down by SyncPodType so periodic syncs can be distinguished
+	// from creates/updates/kills.
+	PodWorkerSyncDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Subsystem: kubeletSubsystem,
+			Name:      "pod_worker_sync_duration_seconds",
+			Help:      "Duration in seconds to sync a single pod, by sync type.",
+		},
+		[]string{"sync_type"},
+	)
+	// PodWorkerRetryCount tracks the cumulative number of sync failures
+	// for a given pod, by pod UID. It is a counter and is not reset when a
+	// later sync succeeds.
+	PodWorkerRetryCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: kubeletSubsystem,
+			Name:      "pod_worker_retry_count",
+			Help:      "Cumulative number of syncPodFn failures for a pod.",
+		},
+		[]string{"pod_uid"},
+	)
+)
+
+var registerMetrics sync.Once
+
+// Register registers the pod worker metrics with the default Prometheus
+// registry. Safe to call multiple times.
+func Register() {
+	registerMetrics.Do(func() {
+		prometheus.MustRegister(PodWorkerQueueDepth)
+		prometheus.MustRegister(PodWorkersInFlight)
+		prometheus.MustRegister(PodWorkerSyncDuration)
+		prometheus.MustRegister(PodWorkerRetryCount)
+	})
+}
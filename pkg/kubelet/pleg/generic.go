@@ -0,0 +1,127 @@
+/*
+Copyright 2014 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pleg
+
+import (
+	"sync"
+	"time"
+
+	kubecontainer "github.com/GoogleCloudPlatform/kubernetes/pkg/kubelet/container"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/types"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util"
+	"github.com/golang/glog"
+)
+
+// GenericPLEG relists the runtimeCache on a fixed period, diffs the result
+// against the previous relist's per-pod container snapshot, and emits a
+// PodLifecycleEvent for every container whose state changed.
+type GenericPLEG struct {
+	// relistPeriod is the interval between two relists.
+	relistPeriod time.Duration
+	// runtimeCache is the source of truth for "what containers are
+	// running right now", already used by podWorkers.
+	runtimeCache kubecontainer.RuntimeCache
+	// eventChannel is where newly generated events are sent; buffered so
+	// a slow consumer doesn't stall the relist goroutine outright.
+	eventChannel chan PodLifecycleEvent
+
+	// podRecordsLock protects podRecords.
+	podRecordsLock sync.Mutex
+	// podRecords is the per-pod container snapshot observed during the
+	// previous relist, keyed by pod UID and then container ID.
+	podRecords map[types.UID]map[string]kubecontainer.ContainerState
+}
+
+// NewGenericPLEG creates a PodLifecycleEventGenerator that relists
+// runtimeCache every relistPeriod.
+func NewGenericPLEG(runtimeCache kubecontainer.RuntimeCache, relistPeriod time.Duration, channelCapacity int) *GenericPLEG {
+	return &GenericPLEG{
+		relistPeriod: relistPeriod,
+		runtimeCache: runtimeCache,
+		eventChannel: make(chan PodLifecycleEvent, channelCapacity),
+		podRecords:   map[types.UID]map[string]kubecontainer.ContainerState{},
+	}
+}
+
+func (g *GenericPLEG) Start() {
+	go util.Until(g.relist, g.relistPeriod, util.NeverStop)
+}
+
+func (g *GenericPLEG) Watch() chan PodLifecycleEvent {
+	return g.eventChannel
+}
+
+// relist queries runtimeCache for the latest view of running containers,
+// diffs it against the previous snapshot per pod, and emits the resulting
+// events. It forces a fresh runtimeCache read so that consumers reading
+// off the Watch channel can rely on the cache already being up to date.
+func (g *GenericPLEG) relist() {
+	if err := g.runtimeCache.ForceUpdateIfOlder(time.Now()); err != nil {
+		glog.Errorf("PLEG: Error updating runtime cache: %v", err)
+		return
+	}
+	pods, err := g.runtimeCache.GetPods()
+	if err != nil {
+		glog.Errorf("PLEG: Error listing pods: %v", err)
+		return
+	}
+
+	g.podRecordsLock.Lock()
+	defer g.podRecordsLock.Unlock()
+
+	seen := map[types.UID]bool{}
+	for _, pod := range pods {
+		seen[pod.ID] = true
+		old := g.podRecords[pod.ID]
+		current := map[string]kubecontainer.ContainerState{}
+		for _, container := range pod.Containers {
+			current[string(container.ID)] = container.State
+			oldState, existed := old[string(container.ID)]
+			switch {
+			case !existed:
+				g.sendEvent(pod.ID, ContainerStarted, container.ID)
+			case oldState != container.State && container.State == kubecontainer.ContainerStateExited:
+				g.sendEvent(pod.ID, ContainerDied, container.ID)
+			}
+		}
+		for id := range old {
+			if _, stillThere := current[id]; !stillThere {
+				g.sendEvent(pod.ID, ContainerRemoved, id)
+			}
+		}
+		g.podRecords[pod.ID] = current
+	}
+	// Any pod we had a record for that didn't show up in this relist has
+	// had all of its containers removed.
+	for uid, old := range g.podRecords {
+		if seen[uid] {
+			continue
+		}
+		for id := range old {
+			g.sendEvent(uid, ContainerRemoved, id)
+		}
+		delete(g.podRecords, uid)
+	}
+}
+
+func (g *GenericPLEG) sendEvent(id types.UID, eventType PodLifecycleEventType, data interface{}) {
+	select {
+	case g.eventChannel <- PodLifecycleEvent{ID: id, Type: eventType, Data: data}:
+	default:
+		glog.Errorf("PLEG: event channel is full, dropping %v event for pod %q", eventType, id)
+	}
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2014 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package pleg implements the Pod Lifecycle Event Generator, which
+// periodically relists the containers known to the container runtime and
+// emits PodLifecycleEvents describing what changed since the previous
+// relist. This lets the kubelet react to container-level changes (a
+// container starting, dying, or being garbage collected) without forcing
+// every podWorkers sync to pay for a full runtime cache refresh.
+package pleg
+
+import (
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/types"
+)
+
+// PodLifecycleEventType defines the type of a PodLifecycleEvent.
+type PodLifecycleEventType string
+
+const (
+	// ContainerStarted is sent when a container enters running state.
+	ContainerStarted PodLifecycleEventType = "ContainerStarted"
+	// ContainerDied is sent when a container transitions out of running
+	// state (including a non-zero exit).
+	ContainerDied PodLifecycleEventType = "ContainerDied"
+	// ContainerRemoved is sent when a container is removed from the
+	// runtime's view entirely (e.g. garbage collected).
+	ContainerRemoved PodLifecycleEventType = "ContainerRemoved"
+)
+
+// PodLifecycleEvent is a change in the life of a pod, as observed by a
+// PodLifecycleEventGenerator.
+type PodLifecycleEvent struct {
+	// ID is the pod the event pertains to.
+	ID types.UID
+	// Type is the type of the event.
+	Type PodLifecycleEventType
+	// Data carries event-specific detail, e.g. the container ID for
+	// ContainerStarted/ContainerDied/ContainerRemoved.
+	Data interface{}
+}
+
+// PodLifecycleEventGenerator periodically inspects the container runtime
+// and surfaces PodLifecycleEvents on its Watch channel.
+type PodLifecycleEventGenerator interface {
+	Start()
+	Watch() chan PodLifecycleEvent
+}
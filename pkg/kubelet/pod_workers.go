@@ -17,33 +17,170 @@ limitations under the License.
 package kubelet
 
 import (
+	"container/heap"
+	"errors"
+	"runtime"
 	"sync"
 	"time"
 
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/client/record"
 	kubecontainer "github.com/GoogleCloudPlatform/kubernetes/pkg/kubelet/container"
+	kubeletmetrics "github.com/GoogleCloudPlatform/kubernetes/pkg/kubelet/metrics"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/kubelet/pleg"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/types"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/util"
 	"github.com/golang/glog"
 )
 
-type syncPodFnType func(*api.Pod, *api.Pod, kubecontainer.Pod) error
+// SyncPodType classifies the reason a pod is being synced, mirroring the
+// ADD/UPDATE/REMOVE/SYNC dispatch that syncLoopIteration performs on the
+// kubelet's config channel. syncPodFn can use it to skip work (e.g.
+// re-inspecting containers) that's only necessary on the first sync of a
+// pod.
+type SyncPodType int
+
+const (
+	// SyncPodSync is the sync triggered by periodic housekeeping.
+	SyncPodSync SyncPodType = iota
+	// SyncPodUpdate is the sync triggered by a change in pod spec.
+	SyncPodUpdate
+	// SyncPodCreate is the sync triggered by a pod creation.
+	SyncPodCreate
+	// SyncPodKill is the sync triggered by pod deletion. It acts as a
+	// tombstone: once requested it must not be overwritten by any
+	// lower-priority sync type.
+	SyncPodKill
+)
+
+func (sp SyncPodType) String() string {
+	switch sp {
+	case SyncPodCreate:
+		return "create"
+	case SyncPodUpdate:
+		return "update"
+	case SyncPodKill:
+		return "kill"
+	default:
+		return "sync"
+	}
+}
+
+// priority ranks SyncPodTypes so that coalesced updates never lose
+// information: a pending kill must never be shadowed by a later sync, and
+// a create must not be downgraded to a sync. It also ranks a pod's place
+// in the worker pool's ready queue, so kills jump ahead of routine syncs.
+func (sp SyncPodType) priority() int {
+	return int(sp)
+}
+
+type syncPodFnType func(*api.Pod, *api.Pod, kubecontainer.Pod, SyncPodType) error
+
+const (
+	// defaultPodWorkersMultiplier is used to size the bounded worker pool
+	// when the caller doesn't request a specific size: workerPoolSize =
+	// runtime.NumCPU() * defaultPodWorkersMultiplier.
+	defaultPodWorkersMultiplier = 4
+
+	// initialSyncBackoff is the backoff applied after a pod's first
+	// consecutive syncPodFn failure.
+	initialSyncBackoff = 100 * time.Millisecond
+	// maxSyncBackoff caps the exponential backoff applied to a
+	// persistently failing pod, matching the retry ceiling syncLoop uses
+	// elsewhere in the kubelet.
+	maxSyncBackoff = 5 * time.Second
+	// syncBackoffFactor is the multiplier applied to the backoff after
+	// each consecutive failure.
+	syncBackoffFactor = 2
+
+	// defaultTerminationGracePeriod is used when a pod being killed
+	// doesn't specify Spec.TerminationGracePeriodSeconds.
+	defaultTerminationGracePeriod = 30 * time.Second
+	// terminationPollInterval is how often a pending kill is re-checked
+	// for whether the runtime cache shows all of a pod's containers
+	// gone, without holding a pool goroutine between checks.
+	terminationPollInterval = 1 * time.Second
+)
+
+// errKillPending is returned by runKillPod while a kill's grace period
+// hasn't yet elapsed and the runtime cache still shows containers for
+// the pod. It is handled by syncPod as a re-check, not a failure: no
+// backoff growth, no retry counting, no failedSync event - just another
+// look after terminationPollInterval, so a node-drain's worth of kills
+// don't tie up the whole pool for the length of their grace period.
+var errKillPending = errors.New("pod termination still waiting on grace period or runtime cache")
 
 type podWorkers struct {
-	// Protects all per worker fields.
+	// Protects all per worker fields below.
 	podLock sync.Mutex
+	// workAvailable is signaled whenever an item is pushed onto queue, so
+	// idle pool goroutines can wake up and claim it.
+	workAvailable *sync.Cond
 
-	// Tracks all running per-pod goroutines - per-pod goroutine will be
-	// processing updates received through its corresponding channel.
-	podUpdates map[types.UID]chan workUpdate
-	// Track the current state of per-pod goroutines.
-	// Currently all update request for a given pod coming when another
-	// update of this pod is being processed are ignored.
+	// pendingWork holds the next workUpdate to run for a pod, coalesced
+	// via mergeWorkUpdate if one is already pending.
+	pendingWork map[types.UID]workUpdate
+	// lastKnownWork remembers, per pod, the most recently delivered
+	// workUpdate, including ones already dispatched to a worker.
+	// HandlePLEGEvent uses it to re-enqueue a sync for a pod that the
+	// PLEG observed a container change for, without the caller having to
+	// resend the full pod spec.
+	lastKnownWork map[types.UID]workUpdate
+	// isWorking is the in-flight set: true while a pool goroutine is
+	// actively running syncPodFn for that pod. It is what guarantees
+	// per-pod serialization now that work isn't pinned to a dedicated
+	// per-pod goroutine/channel.
 	isWorking map[types.UID]bool
-	// Tracks the last undelivered work item for this pod - a work item is
-	// undelivered if it comes in while the worker is working.
-	lastUndeliveredWorkUpdate map[types.UID]workUpdate
+	// queued tracks which pods currently have an entry sitting in queue,
+	// so a pod is never double-enqueued.
+	queued map[types.UID]bool
+	// terminating marks pods that ForgetNonExistingPodWorkers has decided
+	// to tear down: their worker is not reaped, and their bookkeeping is
+	// not dropped, until the graceful kill in syncPod actually confirms
+	// termination. This is what closes the race where closing a channel
+	// mid-sync used to leave containers orphaned.
+	terminating map[types.UID]bool
+	// terminationDeadline records, per pod with a kill in flight, the
+	// point past which runKillPod gives up waiting for a graceful exit
+	// and falls back to a zero grace period kill. Its presence is also
+	// how runKillPod tells a kill it already signaled apart from one it
+	// hasn't gotten to yet, across the re-checks errKillPending drives.
+	terminationDeadline map[types.UID]time.Time
+	// minRuntimeCacheTime records, per pod, the point a future
+	// non-PLEG-triggered sync's runtime cache read must be at least as
+	// fresh as: the moment the pod's previous sync actually read the
+	// cache. runSyncPodFn sets it after every read and forces the cache
+	// to it on the next one, so that guarantee holds exactly rather than
+	// via an arbitrary fixed staleness bound.
+	minRuntimeCacheTime map[types.UID]time.Time
+	// queue is a priority queue of pod UIDs ready to be picked up by a
+	// pool goroutine, ordered by the priority of their pendingWork and
+	// then by arrival order.
+	queue workItemHeap
+	// seq is a monotonically increasing counter used to break priority
+	// ties in FIFO order.
+	seq int64
+
+	// backoff is the current retry backoff for a pod, doubling on every
+	// consecutive syncPodFn failure up to maxSyncBackoff and reset to
+	// zero on success.
+	backoff map[types.UID]time.Duration
+	// retryCount is the number of consecutive syncPodFn failures for a
+	// pod; it feeds both the backoff calculation and the retry-threshold
+	// event.
+	retryCount map[types.UID]int
+	// retryEventThreshold is the number of consecutive failures after
+	// which podWorkers emits an event via recorder so operators can spot
+	// a wedged pod. Zero disables the event.
+	retryEventThreshold int
+
+	// workerPoolSize bounds the number of goroutines concurrently running
+	// syncPodFn, so a node with many churning pods can't spawn an
+	// unbounded number of goroutines hammering runtimeCache.
+	workerPoolSize int
+	// stopCh, closed by Stop, tells pool goroutines to exit.
+	stopCh chan struct{}
+
 	// runtimeCache is used for listing running containers.
 	runtimeCache kubecontainer.RuntimeCache
 
@@ -54,6 +191,15 @@ type podWorkers struct {
 
 	// The EventRecorder to use
 	recorder record.EventRecorder
+
+	// admissionHandlers and evictionHandlers are consulted, in order,
+	// before every non-kill sync; see AddAdmissionHandler and
+	// AddEvictionHandler.
+	admissionHandlers []AdmissionHandler
+	evictionHandlers  []EvictionHandler
+	// statusSetter, if injected via SetPodStatusSetter, is called to
+	// record a pod's status when admission or eviction rejects it.
+	statusSetter PodStatusSetter
 }
 
 type workUpdate struct {
@@ -63,113 +209,495 @@ type workUpdate struct {
 	// The mirror pod of pod; nil if it does not exist.
 	mirrorPod *api.Pod
 
+	// updateType records why this update was generated so syncPodFn and
+	// the coalescing logic in mergeWorkUpdate can make priority decisions.
+	updateType SyncPodType
+
+	// fromPLEG is true when this update was generated by HandlePLEGEvent
+	// rather than by a config change. runSyncPodFn uses it to skip
+	// ForceUpdateIfOlder, since the PLEG relist has already refreshed the
+	// runtime cache more recently than any config-driven sync would.
+	fromPLEG bool
+
 	// Function to call when the update is complete.
 	updateCompleteFn func()
 }
 
-func newPodWorkers(runtimeCache kubecontainer.RuntimeCache, syncPodFn syncPodFnType,
-	recorder record.EventRecorder) *podWorkers {
-	return &podWorkers{
-		podUpdates:                map[types.UID]chan workUpdate{},
-		isWorking:                 map[types.UID]bool{},
-		lastUndeliveredWorkUpdate: map[types.UID]workUpdate{},
-		runtimeCache:              runtimeCache,
-		syncPodFn:                 syncPodFn,
-		recorder:                  recorder,
-	}
-}
-
-func (p *podWorkers) managePodLoop(podUpdates <-chan workUpdate) {
-	var minRuntimeCacheTime time.Time
-	for newWork := range podUpdates {
-		func() {
-			defer p.checkForUpdates(newWork.pod.UID, newWork.updateCompleteFn)
-			// We would like to have the state of Docker from at least the moment
-			// when we finished the previous processing of that pod.
-			if err := p.runtimeCache.ForceUpdateIfOlder(minRuntimeCacheTime); err != nil {
-				glog.Errorf("Error updating docker cache: %v", err)
-				return
-			}
-			pods, err := p.runtimeCache.GetPods()
-			if err != nil {
-				glog.Errorf("Error getting pods while syncing pod: %v", err)
-				return
-			}
+// mergeWorkUpdate combines a pending, undelivered update with a freshly
+// arrived one. The result always carries the newest pod/mirrorPod (so the
+// worker acts on the latest desired state) and the highest-priority
+// updateType seen so far, so a pending kill can't be shadowed by a later
+// sync and a create can't be downgraded to a sync.
+//
+// merged.fromPLEG is true only if both sides were PLEG-derived: fromPLEG
+// lets runSyncPodFn skip ForceUpdateIfOlder on the assumption the PLEG
+// relist already refreshed the cache, and that assumption only holds
+// while nothing else coalesced in. A merge that silently kept
+// pending.fromPLEG's true (or always took newUpdate's, dropping
+// pending's) could let a config-driven update inherit that skip and act
+// on a stale container view.
+func mergeWorkUpdate(pending, newUpdate workUpdate) workUpdate {
+	merged := newUpdate
+	if pending.updateType.priority() > newUpdate.updateType.priority() {
+		merged.updateType = pending.updateType
+	}
+	merged.fromPLEG = pending.fromPLEG && newUpdate.fromPLEG
+	return merged
+}
 
-			err = p.syncPodFn(newWork.pod, newWork.mirrorPod,
-				kubecontainer.Pods(pods).FindPodByID(newWork.pod.UID))
-			if err != nil {
-				glog.Errorf("Error syncing pod %s, skipping: %v", newWork.pod.UID, err)
-				p.recorder.Eventf(newWork.pod, "failedSync", "Error syncing pod, skipping: %v", err)
-				return
-			}
-			minRuntimeCacheTime = time.Now()
+// podWorkItem is a single entry in the ready queue: a pod UID waiting to
+// be picked up by a pool goroutine.
+type podWorkItem struct {
+	uid      types.UID
+	priority int
+	seq      int64
+}
 
-			newWork.updateCompleteFn()
-		}()
+// workItemHeap implements container/heap.Interface, ordering the highest
+// priority item first and breaking ties by arrival order (FIFO).
+type workItemHeap []*podWorkItem
+
+func (h workItemHeap) Len() int { return len(h) }
+func (h workItemHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
 	}
+	return h[i].seq < h[j].seq
+}
+func (h workItemHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *workItemHeap) Push(x interface{}) {
+	*h = append(*h, x.(*podWorkItem))
+}
+func (h *workItemHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
 }
 
-// Apply the new setting to the specified pod. updateComplete is called when the update is completed.
-func (p *podWorkers) UpdatePod(pod *api.Pod, mirrorPod *api.Pod, updateComplete func()) {
-	uid := pod.UID
-	var podUpdates chan workUpdate
-	var exists bool
-
-	p.podLock.Lock()
-	defer p.podLock.Unlock()
-	if podUpdates, exists = p.podUpdates[uid]; !exists {
-		// We need to have a buffer here, because checkForUpdates() method that
-		// puts an update into channel is called from the same goroutine where
-		// the channel is consumed. However, it is guaranteed that in such case
-		// the channel is empty, so buffer of size 1 is enough.
-		podUpdates = make(chan workUpdate, 1)
-		p.podUpdates[uid] = podUpdates
+// newPodWorkers creates a podWorkers backed by a bounded pool of
+// workerPoolSize goroutines. A workerPoolSize <= 0 defaults to
+// runtime.NumCPU() * defaultPodWorkersMultiplier, mirroring the
+// GOMAXPROCS*N default KubeletConfig documents for this setting.
+func newPodWorkers(runtimeCache kubecontainer.RuntimeCache, syncPodFn syncPodFnType,
+	recorder record.EventRecorder, workerPoolSize int, retryEventThreshold int) *podWorkers {
+	if workerPoolSize <= 0 {
+		workerPoolSize = runtime.NumCPU() * defaultPodWorkersMultiplier
+	}
+	kubeletmetrics.Register()
+	p := &podWorkers{
+		pendingWork:         map[types.UID]workUpdate{},
+		lastKnownWork:       map[types.UID]workUpdate{},
+		isWorking:           map[types.UID]bool{},
+		queued:              map[types.UID]bool{},
+		terminating:         map[types.UID]bool{},
+		terminationDeadline: map[types.UID]time.Time{},
+		minRuntimeCacheTime: map[types.UID]time.Time{},
+		backoff:             map[types.UID]time.Duration{},
+		retryCount:          map[types.UID]int{},
+		retryEventThreshold: retryEventThreshold,
+		workerPoolSize:      workerPoolSize,
+		stopCh:              make(chan struct{}),
+		runtimeCache:        runtimeCache,
+		syncPodFn:           syncPodFn,
+		recorder:            recorder,
+	}
+	p.workAvailable = sync.NewCond(&p.podLock)
+	for i := 0; i < workerPoolSize; i++ {
 		go func() {
 			defer util.HandleCrash()
-			p.managePodLoop(podUpdates)
+			p.runWorker()
 		}()
 	}
-	if !p.isWorking[pod.UID] {
-		p.isWorking[pod.UID] = true
-		podUpdates <- workUpdate{
-			pod:              pod,
-			mirrorPod:        mirrorPod,
-			updateCompleteFn: updateComplete,
+	return p
+}
+
+// Stop shuts down every pool goroutine. No further syncs will occur.
+func (p *podWorkers) Stop() {
+	close(p.stopCh)
+	p.podLock.Lock()
+	defer p.podLock.Unlock()
+	p.workAvailable.Broadcast()
+}
+
+// runWorker is the body of one pool goroutine: claim the next ready pod,
+// run its pending sync, and loop. Claiming a pod marks it in-flight
+// (isWorking), which is what keeps two pool goroutines from ever syncing
+// the same pod concurrently.
+func (p *podWorkers) runWorker() {
+	for {
+		uid, work, ok := p.claimNextWork()
+		if !ok {
+			return
+		}
+		p.syncPod(uid, work)
+	}
+}
+
+// claimNextWork blocks until a pod is ready to sync (respecting any
+// backoff delay) or the pool is stopped, then marks it in-flight and
+// returns its pending work.
+func (p *podWorkers) claimNextWork() (types.UID, workUpdate, bool) {
+	p.podLock.Lock()
+	defer p.podLock.Unlock()
+	for {
+		select {
+		case <-p.stopCh:
+			return "", workUpdate{}, false
+		default:
+		}
+		if p.queue.Len() == 0 {
+			kubeletmetrics.PodWorkerQueueDepth.Set(0)
+			p.workAvailable.Wait()
+			continue
 		}
+		item := heap.Pop(&p.queue).(*podWorkItem)
+		kubeletmetrics.PodWorkerQueueDepth.Set(float64(p.queue.Len()))
+		delete(p.queued, item.uid)
+		work, exists := p.pendingWork[item.uid]
+		if !exists {
+			// Work was claimed and cleared by a previous pop; nothing to do.
+			continue
+		}
+		delete(p.pendingWork, item.uid)
+		p.isWorking[item.uid] = true
+		return item.uid, work, true
+	}
+}
+
+// syncPod runs syncPodFn for uid outside of podLock, then reconciles
+// in-flight state, backoff, and any work that coalesced while it ran.
+func (p *podWorkers) syncPod(uid types.UID, work workUpdate) {
+	kubeletmetrics.PodWorkersInFlight.Inc()
+	defer kubeletmetrics.PodWorkersInFlight.Dec()
+
+	start := time.Now()
+	var err error
+	if work.updateType == SyncPodKill {
+		err = p.runKillPod(uid, work)
 	} else {
-		p.lastUndeliveredWorkUpdate[pod.UID] = workUpdate{
-			pod:              pod,
-			mirrorPod:        mirrorPod,
-			updateCompleteFn: updateComplete,
+		err = p.runSyncPodFn(work)
+	}
+	kubeletmetrics.PodWorkerSyncDuration.WithLabelValues(work.updateType.String()).Observe(time.Since(start).Seconds())
+
+	p.podLock.Lock()
+	if err == errKillPending {
+		// The kill is still in progress - not a failure, just not done
+		// yet. Restage it like any other pending work (so finishWork has
+		// something to re-enqueue) but recheck on terminationPollInterval
+		// rather than growing backoff or counting it as a retry; this is
+		// what lets the re-check happen without tying up a pool goroutine
+		// for the length of the grace period.
+		if pending, exists := p.pendingWork[uid]; exists {
+			p.pendingWork[uid] = mergeWorkUpdate(work, pending)
+		} else {
+			p.pendingWork[uid] = work
+		}
+		p.podLock.Unlock()
+		time.AfterFunc(terminationPollInterval, func() { p.finishWork(uid) })
+		return
+	}
+	if err != nil {
+		p.retryCount[uid]++
+		backoff := p.backoff[uid]
+		if backoff == 0 {
+			backoff = initialSyncBackoff
+		} else if backoff < maxSyncBackoff {
+			backoff *= syncBackoffFactor
+			if backoff > maxSyncBackoff {
+				backoff = maxSyncBackoff
+			}
+		}
+		p.backoff[uid] = backoff
+		retries := p.retryCount[uid]
+
+		// claimNextWork already removed this update from pendingWork, so
+		// without restaging it here finishWork has nothing to re-enqueue
+		// and the failed sync - kill or otherwise - is silently dropped.
+		// Merge with whatever coalesced while we were syncing so the
+		// retry doesn't clobber newer work.
+		if pending, exists := p.pendingWork[uid]; exists {
+			p.pendingWork[uid] = mergeWorkUpdate(work, pending)
+		} else {
+			p.pendingWork[uid] = work
+		}
+		p.podLock.Unlock()
+
+		kubeletmetrics.PodWorkerRetryCount.WithLabelValues(string(uid)).Inc()
+		if p.retryEventThreshold > 0 && retries == p.retryEventThreshold {
+			p.recorder.Eventf(work.pod, "failedSync",
+				"Error syncing pod, retried %d times: %v", retries, err)
 		}
+		time.AfterFunc(backoff, func() { p.finishWork(uid) })
+		return
+	}
+
+	p.retryCount[uid] = 0
+	p.backoff[uid] = 0
+	reaped := false
+	if p.terminating[uid] && work.updateType == SyncPodKill {
+		// The pod has been confirmed gone; it's safe to drop every trace
+		// of it rather than leave it around for a future sync to revive.
+		delete(p.lastKnownWork, uid)
+		delete(p.pendingWork, uid)
+		delete(p.backoff, uid)
+		delete(p.retryCount, uid)
+		delete(p.terminating, uid)
+		delete(p.terminationDeadline, uid)
+		delete(p.minRuntimeCacheTime, uid)
+		delete(p.isWorking, uid)
+		delete(p.queued, uid)
+		reaped = true
+	}
+	p.podLock.Unlock()
+	if work.updateCompleteFn != nil {
+		work.updateCompleteFn()
+	}
+	if !reaped {
+		p.finishWork(uid)
 	}
 }
 
-func (p *podWorkers) ForgetNonExistingPodWorkers(desiredPods map[types.UID]empty) {
+// runKillPod drives one step of a pod's termination without ever
+// blocking the calling pool goroutine for the length of the grace
+// period. On the first call for uid it invokes syncPodFn with the
+// kill's termination intent and records a deadline
+// Spec.TerminationGracePeriodSeconds out; every call after that - one
+// per terminationPollInterval, driven by syncPod restaging the work on
+// errKillPending rather than this function sleeping - just checks
+// whether the runtime cache shows every container for the pod gone yet.
+// Once the deadline passes without that being true, it falls back to
+// SIGKILL semantics by invoking syncPodFn again with a zero grace
+// period, then keeps polling until that's confirmed too.
+//
+// A hard error from syncPodFn here is handled by syncPod exactly like
+// any other sync failure: the kill is restaged into pendingWork and
+// retried after the usual backoff. terminating[uid] stays set the whole
+// time, so the pod is never handed back to ForgetNonExistingPodWorkers
+// or reaped until termination is actually confirmed - it can't get stuck
+// with containers still running.
+func (p *podWorkers) runKillPod(uid types.UID, work workUpdate) error {
+	p.podLock.Lock()
+	deadline, signaled := p.terminationDeadline[uid]
+	p.podLock.Unlock()
+
+	if !signaled {
+		if err := p.runSyncPodFn(work); err != nil {
+			return err
+		}
+		grace := defaultTerminationGracePeriod
+		if work.pod.Spec.TerminationGracePeriodSeconds != nil {
+			grace = time.Duration(*work.pod.Spec.TerminationGracePeriodSeconds) * time.Second
+		}
+		deadline = time.Now().Add(grace)
+		p.podLock.Lock()
+		p.terminationDeadline[uid] = deadline
+		p.podLock.Unlock()
+	}
+
+	if p.containersGone(uid) {
+		p.clearTerminationDeadline(uid)
+		return nil
+	}
+	if time.Now().Before(deadline) {
+		return errKillPending
+	}
+
+	glog.Infof("Pod %q did not terminate within its grace period, forcing a zero grace period kill", uid)
+	forceKillPod := *work.pod
+	zeroGrace := int64(0)
+	forceKillPod.Spec.TerminationGracePeriodSeconds = &zeroGrace
+	if err := p.runSyncPodFn(workUpdate{
+		pod:        &forceKillPod,
+		mirrorPod:  work.mirrorPod,
+		updateType: SyncPodKill,
+	}); err != nil {
+		return err
+	}
+	if !p.containersGone(uid) {
+		return errKillPending
+	}
+	p.clearTerminationDeadline(uid)
+	return nil
+}
+
+// clearTerminationDeadline drops the termination-in-progress marker for
+// uid once runKillPod has confirmed the pod's containers are gone.
+func (p *podWorkers) clearTerminationDeadline(uid types.UID) {
 	p.podLock.Lock()
 	defer p.podLock.Unlock()
-	for key, channel := range p.podUpdates {
-		if _, exists := desiredPods[key]; !exists {
-			close(channel)
-			delete(p.podUpdates, key)
-			// If there is an undelivered work update for this pod we need to remove it
-			// since per-pod goroutine won't be able to put it to the already closed
-			// channel when it finish processing the current work update.
-			if _, cached := p.lastUndeliveredWorkUpdate[key]; cached {
-				delete(p.lastUndeliveredWorkUpdate, key)
-			}
+	delete(p.terminationDeadline, uid)
+}
+
+// containersGone reports whether the runtime cache has no containers
+// left for uid.
+func (p *podWorkers) containersGone(uid types.UID) bool {
+	if err := p.runtimeCache.ForceUpdateIfOlder(time.Now()); err != nil {
+		glog.Errorf("Error updating docker cache while waiting for pod %s to terminate: %v", uid, err)
+		return false
+	}
+	pods, err := p.runtimeCache.GetPods()
+	if err != nil {
+		glog.Errorf("Error getting pods while waiting for pod %s to terminate: %v", uid, err)
+		return false
+	}
+	return len(kubecontainer.Pods(pods).FindPodByID(uid).Containers) == 0
+}
+
+// runSyncPodFn refreshes the runtime cache (unless the triggering event
+// already guarantees freshness) and invokes syncPodFn.
+func (p *podWorkers) runSyncPodFn(work workUpdate) error {
+	uid := work.pod.UID
+	// A PLEG-triggered sync already reflects a relist that's newer than
+	// anything a config-driven sync could have forced, so skip paying for
+	// another ForceUpdateIfOlder here.
+	if !work.fromPLEG {
+		p.podLock.Lock()
+		threshold := p.minRuntimeCacheTime[uid]
+		p.podLock.Unlock()
+		if threshold.IsZero() {
+			threshold = time.Now()
+		}
+		if err := p.runtimeCache.ForceUpdateIfOlder(threshold); err != nil {
+			glog.Errorf("Error updating docker cache: %v", err)
+			return err
+		}
+	}
+	pods, err := p.runtimeCache.GetPods()
+	if err != nil {
+		glog.Errorf("Error getting pods while syncing pod: %v", err)
+		return err
+	}
+	p.podLock.Lock()
+	p.minRuntimeCacheTime[uid] = time.Now()
+	p.podLock.Unlock()
+
+	// A kill carries no admission decision to make - a pod that's already
+	// being torn down can't be rejected into existence.
+	if work.updateType != SyncPodKill {
+		if admit, reason, message := p.admitPod(work, pods); !admit {
+			glog.V(3).Infof("Pod %s rejected at admission: %s: %s", work.pod.UID, reason, message)
+			p.rejectPod(work, reason, message)
+			return nil
 		}
 	}
+
+	if err := p.syncPodFn(work.pod, work.mirrorPod, kubecontainer.Pods(pods).FindPodByID(work.pod.UID), work.updateType); err != nil {
+		glog.Errorf("Error syncing pod %s, skipping: %v", work.pod.UID, err)
+		return err
+	}
+	return nil
+}
+
+// finishWork clears the in-flight marker for uid and, if more work
+// coalesced while it was running (or is now ready after a backoff delay),
+// re-enqueues it.
+func (p *podWorkers) finishWork(uid types.UID) {
+	p.podLock.Lock()
+	defer p.podLock.Unlock()
+	p.isWorking[uid] = false
+	if _, exists := p.pendingWork[uid]; exists {
+		p.enqueueLocked(uid)
+	}
+}
+
+// enqueueLocked adds uid to the ready queue if it isn't already queued.
+// Callers must hold podLock and must have already populated
+// pendingWork[uid].
+func (p *podWorkers) enqueueLocked(uid types.UID) {
+	if p.queued[uid] {
+		return
+	}
+	p.queued[uid] = true
+	p.seq++
+	heap.Push(&p.queue, &podWorkItem{
+		uid:      uid,
+		priority: p.pendingWork[uid].updateType.priority(),
+		seq:      p.seq,
+	})
+	kubeletmetrics.PodWorkerQueueDepth.Set(float64(p.queue.Len()))
+	p.workAvailable.Signal()
+}
+
+// UpdatePod applies the new setting to the specified pod. updateType
+// records why the update was generated (create/update/sync/kill) so
+// syncPodFn can skip expensive work on pure periodic syncs.
+// updateComplete is called when the update is completed.
+func (p *podWorkers) UpdatePod(pod *api.Pod, mirrorPod *api.Pod, updateType SyncPodType, updateComplete func()) {
+	uid := pod.UID
+	work := workUpdate{
+		pod:              pod,
+		mirrorPod:        mirrorPod,
+		updateType:       updateType,
+		updateCompleteFn: updateComplete,
+	}
+
+	p.podLock.Lock()
+	defer p.podLock.Unlock()
+	p.lastKnownWork[uid] = work
+	if pending, exists := p.pendingWork[uid]; exists {
+		p.pendingWork[uid] = mergeWorkUpdate(pending, work)
+	} else {
+		p.pendingWork[uid] = work
+	}
+	if !p.isWorking[uid] {
+		p.enqueueLocked(uid)
+	}
 }
 
-func (p *podWorkers) checkForUpdates(uid types.UID, updateComplete func()) {
+// HandlePLEGEvent triggers a sync for just the pod the event pertains to,
+// reusing the same pendingWork coalescing and bounded worker pool that
+// UpdatePod relies on, instead of forcing a sync of every pod.
+func (p *podWorkers) HandlePLEGEvent(event pleg.PodLifecycleEvent) {
 	p.podLock.Lock()
 	defer p.podLock.Unlock()
-	if workUpdate, exists := p.lastUndeliveredWorkUpdate[uid]; exists {
-		p.podUpdates[uid] <- workUpdate
-		delete(p.lastUndeliveredWorkUpdate, uid)
+	known, exists := p.lastKnownWork[event.ID]
+	if !exists {
+		// We have never synced this pod; there's nothing to re-dispatch
+		// until a config-driven update arrives for it.
+		return
+	}
+	work := known
+	work.updateType = SyncPodSync
+	work.fromPLEG = true
+	if pending, exists := p.pendingWork[event.ID]; exists {
+		p.pendingWork[event.ID] = mergeWorkUpdate(pending, work)
 	} else {
-		p.isWorking[uid] = false
+		p.pendingWork[event.ID] = work
+	}
+	if !p.isWorking[event.ID] {
+		p.enqueueLocked(event.ID)
+	}
+}
+
+// ForgetNonExistingPodWorkers tears down workers for any pod no longer in
+// desiredPods. It must not simply drop the pod's bookkeeping: if the pod
+// still has running containers, closing it out here would orphan them.
+// Instead it enqueues a terminal kill workUpdate - the highest-priority
+// SyncPodType, so it can't be shadowed by anything already pending - and
+// only reaps the worker's state once syncPod confirms termination.
+func (p *podWorkers) ForgetNonExistingPodWorkers(desiredPods map[types.UID]empty) {
+	p.podLock.Lock()
+	defer p.podLock.Unlock()
+	for uid, known := range p.lastKnownWork {
+		if _, exists := desiredPods[uid]; exists {
+			continue
+		}
+		if p.terminating[uid] {
+			continue
+		}
+		p.terminating[uid] = true
+		killWork := known
+		killWork.updateType = SyncPodKill
+		killWork.fromPLEG = false
+		if pending, exists := p.pendingWork[uid]; exists {
+			p.pendingWork[uid] = mergeWorkUpdate(pending, killWork)
+		} else {
+			p.pendingWork[uid] = killWork
+		}
+		if !p.isWorking[uid] {
+			p.enqueueLocked(uid)
+		}
 	}
 }